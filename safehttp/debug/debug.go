@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package debug exposes the request and interceptor metrics that
+// safehttp.Task collects automatically for every request, modeled after
+// tailscale.com/tsweb's varz approach: the counters and gauges as expvar
+// variables, and every metric, including the duration histograms, as a
+// Prometheus-compatible text endpoint.
+//
+// Handler is meant to be mounted on a ServeMux that is not reachable from
+// the public Internet, e.g. a separate debug listener bound to loopback; the
+// AllowFunc guard is defense in depth on top of that, not a substitute for
+// it.
+package debug
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/internal/metrics"
+)
+
+// AllowFunc reports whether r may access the debug endpoints registered by
+// Handler.
+type AllowFunc func(r *safehttp.IncomingRequest) bool
+
+// AllowDebugAccess is the AllowFunc used by Handler when none is given. It
+// allows the request only if it originates from loopback, matching tsweb's
+// default.
+func AllowDebugAccess(r *safehttp.IncomingRequest) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr())
+	if err != nil {
+		host = r.RemoteAddr()
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Handler returns an http.Handler serving /debug/vars (the standard expvar
+// JSON dump, which holds the counters and gauges but not the duration
+// histograms) and /debug/metrics (all metrics, histograms included, in the
+// Prometheus text exposition format). Every request is checked against allow first; if
+// allow is nil, AllowDebugAccess is used.
+func Handler(allow AllowFunc) http.Handler {
+	if allow == nil {
+		allow = AllowDebugAccess
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/metrics", writeMetrics)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allow(safehttp.NewIncomingRequest(r)) {
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WritePrometheus(w)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recovery provides a safehttp.Interceptor that lets an application
+// observe panics recovered from a handler or another interceptor, e.g. to
+// forward them to a Sentry-style error sink, without interfering with the
+// normal 500 response or with other interceptors' OnError phase.
+package recovery
+
+import (
+	"context"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// RecoveryInterceptor observes the panic, if any, recovered by
+// safehttp.Task while processing a request. The panic itself is always
+// recovered by Task regardless of whether a RecoveryInterceptor is
+// installed; this interceptor only adds an observation hook on top of that,
+// via OnError, and otherwise lets the normal 500 response (and every other
+// interceptor's OnError phase) run unchanged.
+type RecoveryInterceptor struct {
+	// OnPanic, if non-nil, is called with the recovered panic value and a
+	// bounded stack trace whenever a request's processing panicked. A
+	// typical use is forwarding both to an error-reporting service.
+	OnPanic func(ctx context.Context, recovered interface{}, stack []byte)
+}
+
+// Before is a no-op: RecoveryInterceptor only observes panics, in OnError.
+func (ri RecoveryInterceptor) Before(w *safehttp.Task, r *safehttp.IncomingRequest) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op: RecoveryInterceptor only observes panics, in OnError.
+func (ri RecoveryInterceptor) Commit(w *safehttp.Task, r *safehttp.IncomingRequest, resp safehttp.Response) {
+}
+
+// OnError calls OnPanic if this error response was caused by a recovered
+// panic. It never writes to w, so every other interceptor's OnError phase
+// still runs and the normal 500 response is still sent by
+// safehttp.Task.WriteError.
+func (ri RecoveryInterceptor) OnError(w *safehttp.Task, r *safehttp.IncomingRequest, resp safehttp.Response) {
+	if ri.OnPanic == nil {
+		return
+	}
+	if value, stack, ok := w.Recovered(); ok {
+		ri.OnPanic(r.Context(), value, stack)
+	}
+}
+
+// StreamCommit is a no-op: RecoveryInterceptor only observes panics, in
+// OnError.
+func (ri RecoveryInterceptor) StreamCommit(w *safehttp.Task, r *safehttp.IncomingRequest, resp safehttp.StreamingResponse) {
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+type panickingHandler struct{}
+
+func (panickingHandler) ServeHTTP(t *safehttp.Task, r *safehttp.IncomingRequest) safehttp.Result {
+	panic("boom")
+}
+
+func TestOnPanicCalledOnHandlerPanic(t *testing.T) {
+	var gotValue interface{}
+	var gotStack []byte
+	ri := RecoveryInterceptor{
+		OnPanic: func(ctx context.Context, value interface{}, stack []byte) {
+			gotValue = value
+			gotStack = stack
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	cfg := safehttp.HandlerConfig{
+		Handler:      panickingHandler{},
+		Dispatcher:   &safehttp.DefaultDispatcher{},
+		Interceptors: []safehttp.ConfiguredInterceptor{ri},
+	}
+
+	safehttp.ProcessRequest(cfg, rec, req)
+
+	if gotValue != "boom" {
+		t.Errorf("OnPanic recovered value = %v, want %q", gotValue, "boom")
+	}
+	if len(gotStack) == 0 {
+		t.Error("OnPanic stack was empty, want the panicking goroutine's stack trace")
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("response status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestOnErrorIgnoresNonPanicErrors(t *testing.T) {
+	called := false
+	ri := RecoveryInterceptor{
+		OnPanic: func(ctx context.Context, value interface{}, stack []byte) {
+			called = true
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	w := safehttp.BrokenNewTask(rec, &safehttp.DefaultDispatcher{})
+
+	ri.OnError(w, nil, &safehttp.ErrorResponse{Code: safehttp.StatusBadRequest})
+
+	if called {
+		t.Error("OnPanic was called even though nothing panicked")
+	}
+}
+
+func TestOnErrorNoopWithoutOnPanic(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	cfg := safehttp.HandlerConfig{
+		Handler:      panickingHandler{},
+		Dispatcher:   &safehttp.DefaultDispatcher{},
+		Interceptors: []safehttp.ConfiguredInterceptor{RecoveryInterceptor{}},
+	}
+
+	safehttp.ProcessRequest(cfg, rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("response status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reqlog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestRedactedPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawQuery string
+		drop     []string
+		want     string
+	}{
+		{name: "no query", rawQuery: "", want: "/foo"},
+		{name: "no redaction configured", rawQuery: "b=2&a=1", want: "/foo?b=2&a=1"},
+		{name: "redacts named param", rawQuery: "token=secret&id=1", drop: []string{"token"}, want: "/foo?id=1&token=REDACTED"},
+		{name: "leaves params not in the drop list alone", rawQuery: "id=1", drop: []string{"token"}, want: "/foo?id=1"},
+		{name: "unparseable query is dropped wholesale, not risked", rawQuery: "%zz", drop: []string{"token"}, want: "/foo"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &http.Request{URL: &url.URL{Path: "/foo", RawQuery: tc.rawQuery}}
+			ir := safehttp.NewIncomingRequest(req)
+
+			li := LoggingInterceptor{Redact: Redact{DropQueryParams: tc.drop}}
+			if got := li.redactedPath(ir); got != tc.want {
+				t.Errorf("redactedPath() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	li := LoggingInterceptor{Redact: Redact{
+		DropHeaders: []string{"X-Secret"},
+		HashHeaders: []string{"x-secret", "User-Agent"},
+	}}
+
+	if got := li.redactHeader("X-Secret", "value"); got != "" {
+		t.Errorf("redactHeader(X-Secret) = %q, want \"\": Drop must take precedence over Hash", got)
+	}
+	if got := li.redactHeader("user-agent", "Mozilla/5.0"); got == "" || got == "Mozilla/5.0" {
+		t.Errorf("redactHeader(User-Agent) = %q, want a non-empty hash distinct from the raw value", got)
+	}
+	if got, want := li.redactHeader("Referer", "https://example.com"), "https://example.com"; got != want {
+		t.Errorf("redactHeader(Referer) = %q, want %q unchanged (not configured for redaction)", got, want)
+	}
+}
+
+func TestShortHash(t *testing.T) {
+	a1 := shortHash("a")
+	a2 := shortHash("a")
+	b := shortHash("b")
+
+	if a1 != a2 {
+		t.Errorf("shortHash(%q) is not deterministic: %q != %q", "a", a1, a2)
+	}
+	if a1 == b {
+		t.Errorf("shortHash(%q) == shortHash(%q) = %q, want distinct hashes", "a", "b", a1)
+	}
+	if a1 == "a" {
+		t.Error("shortHash returned its input unchanged")
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	id1 := newRequestID()
+	id2 := newRequestID()
+	if id1 == id2 {
+		t.Errorf("newRequestID returned the same ID twice: %q", id1)
+	}
+	if len(id1) != 32 {
+		t.Errorf("len(newRequestID()) = %d, want 32 (16 random bytes, hex-encoded)", len(id1))
+	}
+}
+
+func TestBeforeReflectsRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+	}{
+		{name: "generates an ID when absent"},
+		{name: "reflects an existing ID back unchanged", existing: "client-supplied-id"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tc.existing != "" {
+				req.Header.Set(defaultRequestIDHeader, tc.existing)
+			}
+			ir := safehttp.NewIncomingRequest(req)
+			rec := httptest.NewRecorder()
+			w := safehttp.BrokenNewTask(rec, nil)
+
+			LoggingInterceptor{}.Before(w, ir)
+
+			got := rec.Header().Get(defaultRequestIDHeader)
+			if got == "" {
+				t.Fatal("X-Request-ID was not set on the response")
+			}
+			if tc.existing != "" && got != tc.existing {
+				t.Errorf("X-Request-ID = %q, want the existing %q reflected back", got, tc.existing)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics holds the counters and histograms that safehttp.Task
+// updates as it processes every request. It has no dependency on the
+// safehttp package itself, so that Task (which needs to record into it) and
+// safehttp/debug (which needs to expose it over HTTP) can both import it
+// without an import cycle, the same way safehttp/internal/wrap is shared.
+//
+// The counters and gauges (Requests, StatusClasses, PanicsRecovered,
+// ContentTypeRejections and InFlight) are published as expvar variables, so
+// they show up at /debug/vars. The duration histograms (InterceptorDuration,
+// HandlerDuration and RequestDuration) are not published as expvar
+// variables; only WritePrometheus renders them. WritePrometheus renders
+// every metric in this package in the Prometheus text exposition format.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Requests counts every request Task has started processing.
+var Requests = expvar.NewInt("safehttp_requests_total")
+
+// StatusClasses counts completed requests by response status class
+// ("1xx", "2xx", "3xx", "4xx" or "5xx").
+var StatusClasses = expvar.NewMap("safehttp_requests_by_status_class")
+
+// PanicsRecovered counts panics recovered from a Handler or interceptor.
+var PanicsRecovered = expvar.NewInt("safehttp_panics_recovered_total")
+
+// ContentTypeRejections counts responses a Dispatcher refused to write
+// because ContentType returned an error.
+var ContentTypeRejections = expvar.NewInt("safehttp_content_type_rejections_total")
+
+// InFlight is the number of requests currently being processed.
+var InFlight = expvar.NewInt("safehttp_requests_in_flight")
+
+// InterceptorDuration is a latency histogram of each interceptor phase
+// (Before, Commit, OnError, StreamCommit), keyed by the interceptor's concrete type name
+// and the phase, e.g. "reqlog.LoggingInterceptor Before".
+var InterceptorDuration = newHistogramVec("safehttp_interceptor_duration_seconds", "interceptor")
+
+// HandlerDuration is a latency histogram of how long a Handler's ServeHTTP
+// took to run, keyed by the handler pattern it was registered under (see
+// safehttp.HandlerConfig.Pattern), or "" if none was given.
+var HandlerDuration = newHistogramVec("safehttp_handler_duration_seconds", "pattern")
+
+// RequestDuration is a latency histogram of a whole request's processing
+// time, from ProcessRequest/Task construction to its response being fully
+// written (or the request panicking past recovery). It has no label: use
+// HandlerDuration for a per-pattern breakdown.
+var RequestDuration = newHistogramVec("safehttp_request_duration_seconds", "")
+
+// StatusClass returns the status class label ("1xx".."5xx") for code, or ""
+// if code is not a valid HTTP status code.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return ""
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// defaultBuckets are the histogram bucket upper bounds, in seconds, used by
+// every histogram in this package. They match Prometheus' own client library defaults.
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram is a minimal cumulative-bucket latency histogram, safe for
+// concurrent use.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // counts[i] = number of observations <= buckets[i]
+	sum     float64
+	count   uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: defaultBuckets, counts: make([]uint64, len(defaultBuckets))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += seconds
+	h.count++
+	for i, le := range h.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+}
+
+// histogramVec is a set of histograms keyed by an arbitrary label, e.g. an
+// interceptor type name and phase. labelName is the Prometheus label name
+// writePrometheus renders label under; a histogramVec with labelName == ""
+// holds a single, unlabeled histogram under the "" key, e.g. RequestDuration.
+type histogramVec struct {
+	name      string
+	labelName string
+
+	mu   sync.Mutex
+	hist map[string]*histogram
+}
+
+func newHistogramVec(name, labelName string) *histogramVec {
+	return &histogramVec{name: name, labelName: labelName, hist: map[string]*histogram{}}
+}
+
+// Observe records an observation of d for the given label, creating its
+// histogram on first use. label is ignored (pass "") for a histogramVec with
+// no labelName.
+func (hv *histogramVec) Observe(label string, d time.Duration) {
+	hv.mu.Lock()
+	h, ok := hv.hist[label]
+	if !ok {
+		h = newHistogram()
+		hv.hist[label] = h
+	}
+	hv.mu.Unlock()
+	h.observe(d.Seconds())
+}
+
+// WritePrometheus renders every metric in this package, including the
+// interceptor duration histogram, in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer) {
+	fmt.Fprintf(w, "# TYPE safehttp_requests_total counter\nsafehttp_requests_total %d\n", Requests.Value())
+	fmt.Fprintf(w, "# TYPE safehttp_panics_recovered_total counter\nsafehttp_panics_recovered_total %d\n", PanicsRecovered.Value())
+	fmt.Fprintf(w, "# TYPE safehttp_content_type_rejections_total counter\nsafehttp_content_type_rejections_total %d\n", ContentTypeRejections.Value())
+	fmt.Fprintf(w, "# TYPE safehttp_requests_in_flight gauge\nsafehttp_requests_in_flight %d\n", InFlight.Value())
+
+	fmt.Fprint(w, "# TYPE safehttp_requests_by_status_class counter\n")
+	StatusClasses.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "safehttp_requests_by_status_class{class=%q} %s\n", kv.Key, kv.Value.String())
+	})
+
+	InterceptorDuration.writePrometheus(w)
+	HandlerDuration.writePrometheus(w)
+	RequestDuration.writePrometheus(w)
+}
+
+func (hv *histogramVec) writePrometheus(w io.Writer) {
+	hv.mu.Lock()
+	labels := make([]string, 0, len(hv.hist))
+	hists := make(map[string]*histogram, len(hv.hist))
+	for label, h := range hv.hist {
+		labels = append(labels, label)
+		hists[label] = h
+	}
+	hv.mu.Unlock()
+	sort.Strings(labels)
+
+	fmt.Fprintf(w, "# TYPE %s histogram\n", hv.name)
+	for _, label := range labels {
+		h := hists[label]
+		labelSet := ""
+		if hv.labelName != "" {
+			labelSet = fmt.Sprintf("%s=%q", hv.labelName, label)
+		}
+
+		h.mu.Lock()
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s} %d\n", hv.name, addLabel(labelSet, "le", fmt.Sprint(le)), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s} %d\n", hv.name, addLabel(labelSet, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", hv.name, labelSet, h.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", hv.name, labelSet, h.count)
+		h.mu.Unlock()
+	}
+}
+
+// addLabel appends name="value" to labelSet, a comma-separated Prometheus
+// label set that may be empty.
+func addLabel(labelSet, name, value string) string {
+	label := fmt.Sprintf("%s=%q", name, value)
+	if labelSet == "" {
+		return label
+	}
+	return labelSet + "," + label
+}
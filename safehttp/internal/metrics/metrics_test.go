@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{200, "2xx"},
+		{204, "2xx"},
+		{301, "3xx"},
+		{404, "4xx"},
+		{500, "5xx"},
+		{0, ""},
+		{999, ""},
+	}
+	for _, tc := range tests {
+		if got := StatusClass(tc.code); got != tc.want {
+			t.Errorf("StatusClass(%d) = %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestHistogramVecWritePrometheus(t *testing.T) {
+	hv := newHistogramVec("test_duration_seconds", "interceptor")
+	hv.Observe("foo.Bar Before", 2*time.Millisecond)
+	hv.Observe("foo.Bar Before", 20*time.Millisecond)
+
+	var b strings.Builder
+	hv.writePrometheus(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		`test_duration_seconds_bucket{interceptor="foo.Bar Before",le="0.025"} 2`,
+		`test_duration_seconds_bucket{interceptor="foo.Bar Before",le="+Inf"} 2`,
+		`test_duration_seconds_count{interceptor="foo.Bar Before"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WritePrometheus output missing %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogramVecWritePrometheusUnlabeled(t *testing.T) {
+	hv := newHistogramVec("test_request_seconds", "")
+	hv.Observe("", 2*time.Millisecond)
+
+	var b strings.Builder
+	hv.writePrometheus(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		`test_request_seconds_bucket{le="0.005"} 1`,
+		`test_request_seconds_sum{} 0.002`,
+		`test_request_seconds_count{} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WritePrometheus output missing %q, got:\n%s", want, out)
+		}
+	}
+}
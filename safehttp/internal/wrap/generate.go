@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build ignore
+// +build ignore
+
+// This program generates wrap_generated.go. It is run via `go generate`,
+// see the directive in wrap.go.
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// bit is one of the four optional interfaces that a wrapped
+// http.ResponseWriter may or may not implement.
+type bit struct {
+	name   string // e.g. "Flusher", used both in the type name and the method block key
+	method string // the Go source for the method(s) this bit adds, %s is the type name
+}
+
+var bits = []bit{
+	{
+		name: "Flusher",
+		method: `
+func (r *%s) Flush() {
+	f := r.w.(http.Flusher).Flush
+	if r.h.Flush != nil {
+		f = r.h.Flush(f)
+	}
+	f()
+}
+`,
+	},
+	{
+		name: "Hijacker",
+		method: `
+func (r *%s) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	f := r.w.(http.Hijacker).Hijack
+	if r.h.Hijack != nil {
+		f = r.h.Hijack(f)
+	}
+	return f()
+}
+`,
+	},
+	{
+		name: "ReadFrom",
+		method: `
+func (r *%s) ReadFrom(src io.Reader) (int64, error) {
+	f := r.w.(io.ReaderFrom).ReadFrom
+	if r.h.ReadFrom != nil {
+		f = r.h.ReadFrom(f)
+	}
+	return f(src)
+}
+`,
+	},
+	{
+		name: "Pusher",
+		method: `
+func (r *%s) Push(target string, opts *http.PushOptions) error {
+	f := r.w.(http.Pusher).Push
+	if r.h.Push != nil {
+		f = r.h.Push(f)
+	}
+	return f(target, opts)
+}
+`,
+	},
+}
+
+// combo is one of the 16 subsets of bits, in the fixed order Flusher,
+// Hijacker, ReadFrom, Pusher.
+type combo []bit
+
+func (c combo) typeName() string {
+	if len(c) == 0 {
+		return "rw"
+	}
+	var b strings.Builder
+	b.WriteString("rw")
+	for _, x := range c {
+		b.WriteString(x.name)
+	}
+	return b.String()
+}
+
+func (c combo) cond() string {
+	has := map[string]bool{}
+	for _, x := range c {
+		has[x.name] = true
+	}
+	var conds []string
+	for _, b := range bits {
+		v := "is" + b.name
+		if !has[b.name] {
+			v = "!" + v
+		}
+		conds = append(conds, v)
+	}
+	return strings.Join(conds, " && ")
+}
+
+func allCombos() []combo {
+	var out []combo
+	for mask := 0; mask < 1<<len(bits); mask++ {
+		var c combo
+		for i, b := range bits {
+			if mask&(1<<i) != 0 {
+				c = append(c, b)
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by generate.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package wrap\n\n")
+	buf.WriteString("import (\n\t\"bufio\"\n\t\"io\"\n\t\"net\"\n\t\"net/http\"\n)\n")
+
+	combos := allCombos()
+	for _, c := range combos {
+		if len(c) == 0 {
+			// "rw" itself is hand-written in wrap.go.
+			continue
+		}
+		name := c.typeName()
+		buf.WriteString("\ntype " + name + " struct {\n\t*rw\n}\n")
+		for _, b := range c {
+			buf.WriteString(strings.ReplaceAll(b.method, "%s", name))
+		}
+	}
+
+	buf.WriteString(`
+// pick returns the rw wrapper whose concrete type implements exactly the
+// combination of optional interfaces described by the given booleans.
+func pick(base *rw, isFlusher, isHijacker, isReadFrom, isPusher bool) http.ResponseWriter {
+	switch {
+`)
+	for _, c := range combos {
+		if len(c) == 0 {
+			buf.WriteString("\tcase " + c.cond() + ":\n\t\treturn base\n")
+			continue
+		}
+		buf.WriteString("\tcase " + c.cond() + ":\n\t\treturn &" + c.typeName() + "{rw: base}\n")
+	}
+	buf.WriteString(`	}
+	// unreachable: the switch above is exhaustive over all 16 combinations.
+	return base
+}
+`)
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated source: %v", err)
+	}
+	if err := ioutil.WriteFile("wrap_generated.go", out, 0644); err != nil {
+		log.Fatalf("writing wrap_generated.go: %v", err)
+	}
+}
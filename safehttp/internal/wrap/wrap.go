@@ -0,0 +1,117 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wrap provides an http.ResponseWriter wrapper that preserves the
+// optional interfaces (http.Flusher, http.Hijacker, io.ReaderFrom,
+// http.Pusher) implemented by the wrapped writer, while still letting the
+// caller observe or alter every call through a set of hooks.
+//
+// This is needed because a naive wrapper struct that only embeds
+// http.ResponseWriter hides those optional interfaces from anything that
+// type-asserts the writer it was handed, which breaks SSE, WebSocket
+// upgrades, HTTP/2 push and efficient file serving. The approach mirrors
+// https://github.com/felixge/httpsnoop: for every one of the 2^4 possible
+// combinations of the four optional interfaces there is a dedicated
+// concrete type that implements exactly that combination, and Wrap picks
+// the right one at construction time based on what the underlying writer
+// actually supports.
+//
+// http.CloseNotifier is intentionally not handled: it has been deprecated
+// since Go 1.11 in favor of request.Context().Done().
+package wrap
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+//go:generate go run generate.go
+
+// WriteHeaderFunc is a hook for http.ResponseWriter.WriteHeader. It is
+// called with the "real" WriteHeader and returns the (possibly wrapped)
+// func that will be invoked in its place.
+type WriteHeaderFunc func(next func(code int)) func(code int)
+
+// WriteFunc is a hook for http.ResponseWriter.Write.
+type WriteFunc func(next func(b []byte) (int, error)) func(b []byte) (int, error)
+
+// FlushFunc is a hook for http.Flusher.Flush.
+type FlushFunc func(next func()) func()
+
+// HijackFunc is a hook for http.Hijacker.Hijack.
+type HijackFunc func(next func() (net.Conn, *bufio.ReadWriter, error)) func() (net.Conn, *bufio.ReadWriter, error)
+
+// ReadFromFunc is a hook for io.ReaderFrom.ReadFrom.
+type ReadFromFunc func(next func(src io.Reader) (int64, error)) func(src io.Reader) (int64, error)
+
+// PushFunc is a hook for http.Pusher.Push.
+type PushFunc func(next func(target string, opts *http.PushOptions) error) func(target string, opts *http.PushOptions) error
+
+// Hooks holds the set of hooks that Wrap will install on the returned
+// http.ResponseWriter. Every field is optional: a nil hook means the
+// corresponding method is forwarded to the underlying writer unchanged.
+type Hooks struct {
+	WriteHeader WriteHeaderFunc
+	Write       WriteFunc
+	Flush       FlushFunc
+	Hijack      HijackFunc
+	ReadFrom    ReadFromFunc
+	Push        PushFunc
+}
+
+// rw is the common core embedded by the 15 generated types. It always
+// implements http.ResponseWriter; the generated types add the optional
+// interfaces on top of it. rw itself is the 16th combination, the one with
+// none of the optional interfaces.
+type rw struct {
+	w http.ResponseWriter
+	h Hooks
+}
+
+func (r *rw) Header() http.Header {
+	return r.w.Header()
+}
+
+func (r *rw) WriteHeader(code int) {
+	f := r.w.WriteHeader
+	if r.h.WriteHeader != nil {
+		f = r.h.WriteHeader(f)
+	}
+	f(code)
+}
+
+func (r *rw) Write(b []byte) (int, error) {
+	f := r.w.Write
+	if r.h.Write != nil {
+		f = r.h.Write(f)
+	}
+	return f(b)
+}
+
+// Wrap returns an http.ResponseWriter that forwards every call to w, running
+// it through the matching hook in hooks first. The concrete type of the
+// result implements exactly the subset of http.Flusher, http.Hijacker,
+// io.ReaderFrom and http.Pusher that w itself implements, so callers can
+// still do e.g. `if f, ok := wrapped.(http.Flusher); ok { ... }`.
+func Wrap(w http.ResponseWriter, hooks Hooks) http.ResponseWriter {
+	_, isFlusher := w.(http.Flusher)
+	_, isHijacker := w.(http.Hijacker)
+	_, isReadFrom := w.(io.ReaderFrom)
+	_, isPusher := w.(http.Pusher)
+
+	base := &rw{w: w, h: hooks}
+	return pick(base, isFlusher, isHijacker, isReadFrom, isPusher)
+}
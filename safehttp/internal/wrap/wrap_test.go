@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrap
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// plainResponseWriter implements only the core http.ResponseWriter methods.
+type plainResponseWriter struct {
+	header http.Header
+	code   int
+}
+
+func (p *plainResponseWriter) Header() http.Header         { return p.header }
+func (p *plainResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (p *plainResponseWriter) WriteHeader(code int)        { p.code = code }
+
+// hijackableResponseWriter additionally implements http.Hijacker.
+type hijackableResponseWriter struct {
+	plainResponseWriter
+	conn      net.Conn
+	hijacked  bool
+	hijackErr error
+}
+
+func (h *hijackableResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), h.hijackErr
+}
+
+func TestWrapPreservesFlusher(t *testing.T) {
+	rec := httptest.NewRecorder()
+	flushed := false
+
+	wrapped := Wrap(rec, Hooks{
+		Flush: func(next func()) func() {
+			return func() {
+				flushed = true
+				next()
+			}
+		},
+	})
+
+	f, ok := wrapped.(http.Flusher)
+	if !ok {
+		t.Fatalf("wrapped writer does not implement http.Flusher, but the underlying httptest.ResponseRecorder does")
+	}
+	f.Flush()
+
+	if !flushed {
+		t.Error("Flush hook was not invoked")
+	}
+	if !rec.Flushed {
+		t.Error("underlying ResponseRecorder was not flushed")
+	}
+}
+
+func TestWrapPreservesHijacker(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	underlying := &hijackableResponseWriter{
+		plainResponseWriter: plainResponseWriter{header: http.Header{}},
+		conn:                server,
+	}
+
+	hijacked := false
+	wrapped := Wrap(underlying, Hooks{
+		Hijack: func(next func() (net.Conn, *bufio.ReadWriter, error)) func() (net.Conn, *bufio.ReadWriter, error) {
+			return func() (net.Conn, *bufio.ReadWriter, error) {
+				hijacked = true
+				return next()
+			}
+		},
+	})
+
+	hj, ok := wrapped.(http.Hijacker)
+	if !ok {
+		t.Fatalf("wrapped writer does not implement http.Hijacker, but the underlying writer does")
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		t.Fatalf("Hijack(): got error %v, want nil", err)
+	}
+	defer conn.Close()
+
+	if !hijacked {
+		t.Error("Hijack hook was not invoked")
+	}
+	if !underlying.hijacked {
+		t.Error("underlying Hijack was not called")
+	}
+}
+
+func TestWrapOmitsUnsupportedInterfaces(t *testing.T) {
+	underlying := &plainResponseWriter{header: http.Header{}}
+	wrapped := Wrap(underlying, Hooks{})
+
+	if _, ok := wrapped.(http.Flusher); ok {
+		t.Error("wrapped writer implements http.Flusher, but the underlying writer does not")
+	}
+	if _, ok := wrapped.(http.Hijacker); ok {
+		t.Error("wrapped writer implements http.Hijacker, but the underlying writer does not")
+	}
+}
@@ -16,7 +16,9 @@ package collector
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/google/go-safeweb/safehttp"
 )
@@ -80,6 +82,125 @@ type CSPReport struct {
 	ColumnNumber uint
 }
 
+// NELReport represents a Network Error Logging report as specified by
+// https://w3c.github.io/network-error-logging/#dfn-network-error-report
+type NELReport struct {
+	// SamplingFraction is the sampling rate applied when this report was
+	// generated, between 0 and 1.
+	SamplingFraction float64 `json:"sampling_fraction"`
+	// ElapsedTime is the number of milliseconds between the start of the
+	// request and when it was completed or aborted.
+	ElapsedTime uint `json:"elapsed_time"`
+	// Phase is the phase of the request during which the error occurred,
+	// e.g. "dns", "connection" or "application".
+	Phase string `json:"phase"`
+	// Type is the type of network error encountered, e.g. "tcp.refused" or
+	// "http.protocol.error".
+	Type string `json:"type"`
+	// ServerIP is the IP address of the server that the request was made to.
+	ServerIP string `json:"server_ip"`
+	// Protocol is the protocol used to fetch the resource, e.g. "http/1.1".
+	Protocol string `json:"protocol"`
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+	// RequestHeaders holds request header values that the server opted into
+	// reporting through its NEL policy's header allowlist.
+	RequestHeaders map[string][]string `json:"request_headers"`
+	// ResponseHeaders holds response header values that the server opted
+	// into reporting.
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	// StatusCode is the HTTP status code of the response, if one was
+	// received.
+	StatusCode uint `json:"status_code"`
+}
+
+// COOPReport represents a Cross-Origin-Opener-Policy violation report as
+// specified by https://html.spec.whatwg.org/multipage/origin.html#coop-reports
+type COOPReport struct {
+	// Type is either "navigation-from-response" or "navigation-to-response"
+	// depending on which side of the navigation triggered the report.
+	Type string `json:"type"`
+	// Disposition is either "enforce" or "reporting" depending on whether
+	// the Cross-Origin-Opener-Policy or the
+	// Cross-Origin-Opener-Policy-Report-Only header is used.
+	Disposition string `json:"disposition"`
+	// EffectivePolicy is the COOP value that was effective when the report
+	// was generated.
+	EffectivePolicy string `json:"effectivePolicy"`
+	// PreviousResponseURL is the URL of the document that was navigated
+	// away from, if disclosable.
+	PreviousResponseURL string `json:"previousResponseURL"`
+	// NextResponseURL is the URL of the document that was navigated to, if
+	// disclosable.
+	NextResponseURL string `json:"nextResponseURL"`
+	// Referrer is the referrer of the navigation that triggered the report.
+	Referrer string `json:"referrer"`
+}
+
+// COEPReport represents a Cross-Origin-Embedder-Policy violation report as
+// specified by https://wicg.github.io/cross-origin-embedder-policy/#coep-report-type
+type COEPReport struct {
+	// Type is always "corp" for a report triggered by a blocked subresource.
+	Type string `json:"type"`
+	// BlockedURL is the URL of the subresource that was blocked from
+	// loading.
+	BlockedURL string `json:"blockedURL"`
+	// Disposition is either "enforce" or "reporting" depending on whether
+	// the Cross-Origin-Embedder-Policy or the
+	// Cross-Origin-Embedder-Policy-Report-Only header is used.
+	Disposition string `json:"disposition"`
+	// Destination is the request destination of the blocked subresource,
+	// e.g. "image" or "script".
+	Destination string `json:"destination"`
+}
+
+// DeprecationReport represents a usage of a deprecated web platform feature,
+// as specified by https://wicg.github.io/deprecation-reporting/#deprecationreportbody
+type DeprecationReport struct {
+	// ID is a machine readable identifier of the deprecated feature.
+	ID string `json:"id"`
+	// Message is a human readable description of the deprecation.
+	Message string `json:"message"`
+	// SourceFile is the URL of the script that used the deprecated feature.
+	SourceFile string `json:"sourceFile"`
+	// LineNumber is the line number in SourceFile at which the deprecated
+	// feature was used.
+	LineNumber uint `json:"lineNumber"`
+	// ColumnNumber is the column number in SourceFile at which the
+	// deprecated feature was used.
+	ColumnNumber uint `json:"columnNumber"`
+	// AnticipatedRemoval is the date at which the feature is expected to be
+	// removed, if known.
+	AnticipatedRemoval string `json:"anticipatedRemoval"`
+}
+
+// InterventionReport represents a case where the browser intervened on
+// potentially harmful behavior, as specified by
+// https://wicg.github.io/intervention-reporting/#intervention-report
+type InterventionReport struct {
+	// ID is a machine readable identifier of the intervention.
+	ID string `json:"id"`
+	// Message is a human readable description of the intervention.
+	Message string `json:"message"`
+	// SourceFile is the URL of the script that triggered the intervention.
+	SourceFile string `json:"sourceFile"`
+	// LineNumber is the line number in SourceFile at which the intervention
+	// was triggered.
+	LineNumber uint `json:"lineNumber"`
+	// ColumnNumber is the column number in SourceFile at which the
+	// intervention was triggered.
+	ColumnNumber uint `json:"columnNumber"`
+}
+
+// CrashReport represents a renderer crash, as specified by
+// https://wicg.github.io/crash-reporting/#crash-report
+type CrashReport struct {
+	// CrashID uniquely identifies the crash.
+	CrashID string `json:"crashId"`
+	// Reason is the reason for the crash, e.g. "oom".
+	Reason string `json:"reason"`
+}
+
 // HandlerBuilder creates a safehttp.Handler based on the report handlers that
 // it's created with.
 type HandlerBuilder struct {
@@ -87,6 +208,31 @@ type HandlerBuilder struct {
 	Handler func(Report)
 	// CSPHandler handles all CSP reports received with the Content-Type application/csp-report.
 	CSPHandler func(CSPReport)
+	// NELHandler handles Network Error Logging reports (type "network-error").
+	NELHandler func(NELReport)
+	// COOPHandler handles Cross-Origin-Opener-Policy violation reports (type "coop").
+	COOPHandler func(COOPReport)
+	// COEPHandler handles Cross-Origin-Embedder-Policy violation reports (type "coep").
+	COEPHandler func(COEPReport)
+	// DeprecationHandler handles deprecated feature usage reports (type "deprecation").
+	DeprecationHandler func(DeprecationReport)
+	// InterventionHandler handles browser intervention reports (type "intervention").
+	InterventionHandler func(InterventionReport)
+	// CrashHandler handles renderer crash reports (type "crash").
+	CrashHandler func(CrashReport)
+}
+
+// hasAnyHandler reports whether at least one of the application/reports+json
+// handlers was configured, i.e. whether it's worth parsing the request body
+// at all.
+func (hb HandlerBuilder) hasAnyHandler() bool {
+	return hb.Handler != nil ||
+		hb.NELHandler != nil ||
+		hb.COOPHandler != nil ||
+		hb.COEPHandler != nil ||
+		hb.DeprecationHandler != nil ||
+		hb.InterventionHandler != nil ||
+		hb.CrashHandler != nil
 }
 
 // Build builds a safehttp.Handler which calls the given Handler or CSPHandler when
@@ -107,8 +253,8 @@ func (hb HandlerBuilder) Build() safehttp.Handler {
 		ct := r.Header.Get("Content-Type")
 		if ct == "application/csp-report" && hb.CSPHandler != nil {
 			return handleDeprecatedCSPReports(hb.CSPHandler, w, b)
-		} else if ct == "application/reports+json" && hb.Handler != nil {
-			return handleReport(hb.Handler, w, b)
+		} else if ct == "application/reports+json" && hb.hasAnyHandler() {
+			return handleReport(hb, w, b)
 		}
 
 		return w.ClientError(safehttp.StatusUnsupportedMediaType)
@@ -133,6 +279,21 @@ func uintOrZero(x interface{}) uint {
 	return uint(f)
 }
 
+// decode populates dst, which must be a pointer to one of the typed report
+// structs, from the generic JSON object m. It round-trips m through
+// encoding/json rather than reflecting over it field by field, so, just
+// like stringOrEmpty and uintOrZero, it tolerates missing fields: they are
+// simply left at their zero value. A field present with an unexpected type
+// makes encoding/json report an error for that field alone, which decode
+// propagates to the caller, but every other field is still populated.
+func decode(m map[string]interface{}, dst interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
 func handleDeprecatedCSPReports(h func(CSPReport), w *safehttp.ResponseWriter, b []byte) safehttp.Result {
 	// In CSP2 it is clearly stated that a report has a single key 'csp-report'
 	// which holds the report object. Like this:
@@ -192,7 +353,100 @@ func handleDeprecatedCSPReports(h func(CSPReport), w *safehttp.ResponseWriter, b
 	return w.NoContent()
 }
 
-func handleReport(h func(Report), w *safehttp.ResponseWriter, b []byte) safehttp.Result {
+// dispatchReport decodes a single report's body m into the typed report
+// struct selected by out.Type, calls the matching typed handler on hb if one
+// is configured (csp-violation has none here), and returns out with Body replaced by the typed struct.
+// ok is false if out.Type is one of the well-known types above but a field
+// in m didn't decode into the expected shape; out.Body is still replaced
+// with whatever decode managed to populate in that case.
+func dispatchReport(hb HandlerBuilder, r Report, m map[string]interface{}) (out Report, ok bool) {
+	out = r
+	ok = true
+
+	// The well-known report types below, except csp-violation, are
+	// dispatched to their own typed handler, in addition to being passed,
+	// still typed, to the generic Handler by handleReport. A csp-violation
+	// body is converted to a CSPReport but is not passed to CSPHandler.
+	// Anything else is left as the raw map[string]interface{} that
+	// encoding/json produced for r.Body.
+	switch r.Type {
+	case "csp-violation":
+		// https://w3c.github.io/webappsec-csp/#reporting
+		out.Body = CSPReport{
+			BlockedURL:         stringOrEmpty(m["blockedURL"]),
+			Disposition:        stringOrEmpty(m["disposition"]),
+			DocumentURL:        stringOrEmpty(m["documentURL"]),
+			EffectiveDirective: stringOrEmpty(m["effectiveDirective"]),
+			OriginalPolicy:     stringOrEmpty(m["originalPolicy"]),
+			Referrer:           stringOrEmpty(m["referrer"]),
+			Sample:             stringOrEmpty(m["sample"]),
+			StatusCode:         uintOrZero(m["statusCode"]),
+			// In CSP3 ViolatedDirective has been removed but is kept as
+			// a copy of EffectiveDirective for backwards compatibility.
+			ViolatedDirective: stringOrEmpty(m["effectiveDirective"]),
+			SourceFile:        stringOrEmpty(m["sourceFile"]),
+			LineNumber:        uintOrZero(m["lineNumber"]),
+			ColumnNumber:      uintOrZero(m["columnNumber"]),
+		}
+	case "network-error":
+		var nel NELReport
+		if err := decode(m, &nel); err != nil {
+			ok = false
+		}
+		out.Body = nel
+		if hb.NELHandler != nil {
+			hb.NELHandler(nel)
+		}
+	case "coop":
+		var coop COOPReport
+		if err := decode(m, &coop); err != nil {
+			ok = false
+		}
+		out.Body = coop
+		if hb.COOPHandler != nil {
+			hb.COOPHandler(coop)
+		}
+	case "coep":
+		var coep COEPReport
+		if err := decode(m, &coep); err != nil {
+			ok = false
+		}
+		out.Body = coep
+		if hb.COEPHandler != nil {
+			hb.COEPHandler(coep)
+		}
+	case "deprecation":
+		var dep DeprecationReport
+		if err := decode(m, &dep); err != nil {
+			ok = false
+		}
+		out.Body = dep
+		if hb.DeprecationHandler != nil {
+			hb.DeprecationHandler(dep)
+		}
+	case "intervention":
+		var iv InterventionReport
+		if err := decode(m, &iv); err != nil {
+			ok = false
+		}
+		out.Body = iv
+		if hb.InterventionHandler != nil {
+			hb.InterventionHandler(iv)
+		}
+	case "crash":
+		var cr CrashReport
+		if err := decode(m, &cr); err != nil {
+			ok = false
+		}
+		out.Body = cr
+		if hb.CrashHandler != nil {
+			hb.CrashHandler(cr)
+		}
+	}
+	return out, ok
+}
+
+func handleReport(hb HandlerBuilder, w *safehttp.ResponseWriter, b []byte) safehttp.Result {
 	var rList []Report
 	if err := json.Unmarshal(b, &rList); err != nil {
 		return w.ClientError(safehttp.StatusBadRequest)
@@ -206,26 +460,14 @@ func handleReport(h func(Report), w *safehttp.ResponseWriter, b []byte) safehttp
 			continue
 		}
 
-		if r.Type == "csp-violation" {
-			// https://w3c.github.io/webappsec-csp/#reporting
-			r.Body = CSPReport{
-				BlockedURL:         stringOrEmpty(m["blockedURL"]),
-				Disposition:        stringOrEmpty(m["disposition"]),
-				DocumentURL:        stringOrEmpty(m["documentURL"]),
-				EffectiveDirective: stringOrEmpty(m["effectiveDirective"]),
-				OriginalPolicy:     stringOrEmpty(m["originalPolicy"]),
-				Referrer:           stringOrEmpty(m["referrer"]),
-				Sample:             stringOrEmpty(m["sample"]),
-				StatusCode:         uintOrZero(m["statusCode"]),
-				// In CSP3 ViolatedDirective has been removed but is kept as
-				// a copy of EffectiveDirective for backwards compatibility.
-				ViolatedDirective: stringOrEmpty(m["effectiveDirective"]),
-				SourceFile:        stringOrEmpty(m["sourceFile"]),
-				LineNumber:        uintOrZero(m["lineNumber"]),
-				ColumnNumber:      uintOrZero(m["columnNumber"]),
-			}
-		}
-		h(r)
+		r, ok = dispatchReport(hb, r, m)
+		if !ok {
+			badRequest = true
+		}
+
+		if hb.Handler != nil {
+			hb.Handler(r)
+		}
 	}
 
 	if badRequest {
@@ -234,3 +476,119 @@ func handleReport(h func(Report), w *safehttp.ResponseWriter, b []byte) safehttp
 
 	return w.NoContent()
 }
+
+// Endpoint is a single named reporting destination, as configured by the
+// Reporting-Endpoints and (deprecated) Report-To response headers.
+type Endpoint struct {
+	// Group is the name reports are grouped under, e.g. "default" or
+	// "network-errors". NEL, COOP and COEP reports are routed to the group
+	// named in the NEL policy or in COOPReportTo/COEPReportTo below.
+	Group string
+	// URL is where reports for Group are sent, usually on a different,
+	// report-collector-only origin.
+	URL string
+	// MaxAge is how long, in seconds, the browser should remember this
+	// endpoint for. Only used to populate the deprecated Report-To header.
+	MaxAge int
+}
+
+// NELPolicy is the value of the NEL response header, as specified by
+// https://w3c.github.io/network-error-logging/#nel-response-header
+type NELPolicy struct {
+	// ReportTo is the Endpoint.Group that network error reports are sent to.
+	ReportTo string
+	// MaxAge is how long, in seconds, the browser should apply this policy
+	// for.
+	MaxAge int
+	// IncludeSubdomains, if true, applies this policy to subdomains of the
+	// origin that served it too.
+	IncludeSubdomains bool
+	// SuccessFraction is the fraction, between 0 and 1, of successful
+	// requests to sample for reporting.
+	SuccessFraction float64
+	// FailureFraction is the fraction, between 0 and 1, of failed requests
+	// to sample for reporting.
+	FailureFraction float64
+}
+
+// Interceptor configures the Reporting API v1 endpoints that the browser
+// should send reports to, together with the headers that opt individual
+// features into reporting: NEL, Cross-Origin-Opener-Policy-Report-Only and
+// Cross-Origin-Embedder-Policy-Report-Only. It implements safehttp.Interceptor
+// so an application can advertise the endpoints and receive the matching
+// reports through a HandlerBuilder in one place.
+//
+// Interceptor only ever adds headers, so its Commit and OnError phases are
+// no-ops; only Before is implemented.
+type Interceptor struct {
+	// Endpoints lists every reporting destination this Interceptor should
+	// advertise. It is serialized into both the Reporting-Endpoints header
+	// (new clients) and the Report-To header (old clients).
+	Endpoints []Endpoint
+	// NEL, if non-nil, is serialized into the NEL response header to
+	// enable Network Error Logging for the response's origin. NEL.ReportTo
+	// must name a group present in Endpoints.
+	NEL *NELPolicy
+	// COOPReportTo, if non-empty, must name a group present in Endpoints;
+	// Cross-Origin-Opener-Policy-Report-Only violations are sent there.
+	COOPReportTo string
+	// COEPReportTo, if non-empty, must name a group present in Endpoints;
+	// Cross-Origin-Embedder-Policy-Report-Only violations are sent there.
+	COEPReportTo string
+}
+
+// Before adds the Reporting-Endpoints, Report-To, NEL,
+// Cross-Origin-Opener-Policy-Report-Only and
+// Cross-Origin-Embedder-Policy-Report-Only headers, as configured on it, to
+// every response.
+func (it Interceptor) Before(w *safehttp.Task, r *safehttp.IncomingRequest) safehttp.Result {
+	if len(it.Endpoints) > 0 {
+		var reportingEndpoints []string
+		var reportTo []string
+		for _, e := range it.Endpoints {
+			reportingEndpoints = append(reportingEndpoints, fmt.Sprintf(`%s="%s"`, e.Group, e.URL))
+			reportTo = append(reportTo, fmt.Sprintf(`{"group":%q,"max_age":%d,"endpoints":[{"url":%q}]}`, e.Group, e.MaxAge, e.URL))
+		}
+		w.Header().Set("Reporting-Endpoints", strings.Join(reportingEndpoints, ", "))
+		// Report-To takes a comma-separated list of JSON objects, same as
+		// Reporting-Endpoints above; a raw "\n" would be rewritten to a
+		// space by net/http (headers can't contain newlines) and leave the
+		// groups comma-less, which browsers can't parse past the first one.
+		w.Header().Set("Report-To", strings.Join(reportTo, ", "))
+	}
+
+	if it.NEL != nil {
+		nel, err := json.Marshal(struct {
+			ReportTo          string  `json:"report_to"`
+			MaxAge            int     `json:"max_age"`
+			IncludeSubdomains bool    `json:"include_subdomains,omitempty"`
+			SuccessFraction   float64 `json:"success_fraction,omitempty"`
+			FailureFraction   float64 `json:"failure_fraction,omitempty"`
+		}{
+			ReportTo:          it.NEL.ReportTo,
+			MaxAge:            it.NEL.MaxAge,
+			IncludeSubdomains: it.NEL.IncludeSubdomains,
+			SuccessFraction:   it.NEL.SuccessFraction,
+			FailureFraction:   it.NEL.FailureFraction,
+		})
+		if err == nil {
+			w.Header().Set("NEL", string(nel))
+		}
+	}
+
+	if it.COOPReportTo != "" {
+		w.Header().Set("Cross-Origin-Opener-Policy-Report-Only", fmt.Sprintf(`same-origin; report-to=%q`, it.COOPReportTo))
+	}
+	if it.COEPReportTo != "" {
+		w.Header().Set("Cross-Origin-Embedder-Policy-Report-Only", fmt.Sprintf(`require-corp; report-to=%q`, it.COEPReportTo))
+	}
+
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op: Interceptor only adds headers in Before.
+func (it Interceptor) Commit(w *safehttp.Task, r *safehttp.IncomingRequest, resp safehttp.Response) {}
+
+// OnError is a no-op: Interceptor only adds headers in Before.
+func (it Interceptor) OnError(w *safehttp.Task, r *safehttp.IncomingRequest, resp safehttp.Response) {
+}
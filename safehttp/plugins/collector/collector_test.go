@@ -0,0 +1,261 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// trackingHandlerBuilder is a HandlerBuilder whose typed handlers record the
+// value they were called with, so a single struct literal can assert that
+// dispatchReport called the right handler for every report type without a
+// bespoke HandlerBuilder per test case.
+type trackingHandlerBuilder struct {
+	HandlerBuilder
+	got interface{}
+}
+
+func newTrackingHandlerBuilder(reportType string) *trackingHandlerBuilder {
+	hb := &trackingHandlerBuilder{}
+	switch reportType {
+	case "network-error":
+		hb.NELHandler = func(r NELReport) { hb.got = r }
+	case "coop":
+		hb.COOPHandler = func(r COOPReport) { hb.got = r }
+	case "coep":
+		hb.COEPHandler = func(r COEPReport) { hb.got = r }
+	case "deprecation":
+		hb.DeprecationHandler = func(r DeprecationReport) { hb.got = r }
+	case "intervention":
+		hb.InterventionHandler = func(r InterventionReport) { hb.got = r }
+	case "crash":
+		hb.CrashHandler = func(r CrashReport) { hb.got = r }
+	}
+	return hb
+}
+
+func TestDispatchReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		reportType string
+		body       map[string]interface{}
+		wantOK     bool
+		check      func(t *testing.T, got interface{}, body interface{})
+	}{
+		{
+			name:       "network-error",
+			reportType: "network-error",
+			body:       map[string]interface{}{"type": "tcp.refused", "phase": "connection"},
+			wantOK:     true,
+			check: func(t *testing.T, got, body interface{}) {
+				nel, ok := body.(NELReport)
+				if !ok {
+					t.Fatalf("Body = %T, want NELReport", body)
+				}
+				if nel.Type != "tcp.refused" || nel.Phase != "connection" {
+					t.Errorf("Body = %+v, want Type=tcp.refused Phase=connection", nel)
+				}
+				if got == nil {
+					t.Error("NELHandler was not called")
+				}
+			},
+		},
+		{
+			name:       "coop",
+			reportType: "coop",
+			body:       map[string]interface{}{"type": "navigation-from-response"},
+			wantOK:     true,
+			check: func(t *testing.T, got, body interface{}) {
+				coop, ok := body.(COOPReport)
+				if !ok {
+					t.Fatalf("Body = %T, want COOPReport", body)
+				}
+				if coop.Type != "navigation-from-response" {
+					t.Errorf("Body = %+v, want Type=navigation-from-response", coop)
+				}
+				if got == nil {
+					t.Error("COOPHandler was not called")
+				}
+			},
+		},
+		{
+			name:       "coep",
+			reportType: "coep",
+			body:       map[string]interface{}{"blockedURL": "https://example.com/img.png"},
+			wantOK:     true,
+			check: func(t *testing.T, got, body interface{}) {
+				coep, ok := body.(COEPReport)
+				if !ok {
+					t.Fatalf("Body = %T, want COEPReport", body)
+				}
+				if coep.BlockedURL != "https://example.com/img.png" {
+					t.Errorf("Body = %+v, want BlockedURL=https://example.com/img.png", coep)
+				}
+				if got == nil {
+					t.Error("COEPHandler was not called")
+				}
+			},
+		},
+		{
+			name:       "deprecation",
+			reportType: "deprecation",
+			body:       map[string]interface{}{"id": "DeprecatedFeature"},
+			wantOK:     true,
+			check: func(t *testing.T, got, body interface{}) {
+				dep, ok := body.(DeprecationReport)
+				if !ok {
+					t.Fatalf("Body = %T, want DeprecationReport", body)
+				}
+				if dep.ID != "DeprecatedFeature" {
+					t.Errorf("Body = %+v, want ID=DeprecatedFeature", dep)
+				}
+				if got == nil {
+					t.Error("DeprecationHandler was not called")
+				}
+			},
+		},
+		{
+			name:       "intervention",
+			reportType: "intervention",
+			body:       map[string]interface{}{"id": "SomeIntervention"},
+			wantOK:     true,
+			check: func(t *testing.T, got, body interface{}) {
+				iv, ok := body.(InterventionReport)
+				if !ok {
+					t.Fatalf("Body = %T, want InterventionReport", body)
+				}
+				if iv.ID != "SomeIntervention" {
+					t.Errorf("Body = %+v, want ID=SomeIntervention", iv)
+				}
+				if got == nil {
+					t.Error("InterventionHandler was not called")
+				}
+			},
+		},
+		{
+			name:       "crash",
+			reportType: "crash",
+			body:       map[string]interface{}{"crashId": "abc123", "reason": "oom"},
+			wantOK:     true,
+			check: func(t *testing.T, got, body interface{}) {
+				cr, ok := body.(CrashReport)
+				if !ok {
+					t.Fatalf("Body = %T, want CrashReport", body)
+				}
+				if cr.CrashID != "abc123" || cr.Reason != "oom" {
+					t.Errorf("Body = %+v, want CrashID=abc123 Reason=oom", cr)
+				}
+				if got == nil {
+					t.Error("CrashHandler was not called")
+				}
+			},
+		},
+		{
+			name:       "network-error with mistyped field fails decode",
+			reportType: "network-error",
+			body:       map[string]interface{}{"type": 42}, // Type is a string field.
+			wantOK:     false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hb := newTrackingHandlerBuilder(tc.reportType)
+
+			out, ok := dispatchReport(hb.HandlerBuilder, Report{Type: tc.reportType, Body: tc.body}, tc.body)
+			if ok != tc.wantOK {
+				t.Fatalf("dispatchReport ok = %v, want %v", ok, tc.wantOK)
+			}
+			if tc.check != nil {
+				tc.check(t, hb.got, out.Body)
+			}
+		})
+	}
+}
+
+func TestInterceptorBeforeHeaders(t *testing.T) {
+	it := Interceptor{
+		Endpoints: []Endpoint{
+			{Group: "default", URL: "https://example.com/reports", MaxAge: 86400},
+			{Group: "network-errors", URL: "https://example.com/nel", MaxAge: 3600},
+		},
+		NEL: &NELPolicy{
+			ReportTo:          "network-errors",
+			MaxAge:            3600,
+			IncludeSubdomains: true,
+			SuccessFraction:   0.5,
+		},
+		COOPReportTo: "default",
+		COEPReportTo: "default",
+	}
+
+	rec := httptest.NewRecorder()
+	w := safehttp.BrokenNewTask(rec, nil)
+
+	if result := it.Before(w, nil); result != safehttp.NotWritten() {
+		t.Errorf("Before = %v, want NotWritten", result)
+	}
+
+	reportingEndpoints := rec.Header().Get("Reporting-Endpoints")
+	for _, want := range []string{`default="https://example.com/reports"`, `network-errors="https://example.com/nel"`} {
+		if !strings.Contains(reportingEndpoints, want) {
+			t.Errorf("Reporting-Endpoints = %q, want it to contain %q", reportingEndpoints, want)
+		}
+	}
+	if !strings.Contains(reportingEndpoints, ", ") {
+		t.Errorf("Reporting-Endpoints = %q, want groups joined with \", \"", reportingEndpoints)
+	}
+
+	reportTo := rec.Header().Get("Report-To")
+	if n := strings.Count(reportTo, "}, {"); n != 1 {
+		t.Errorf("Report-To = %q, want exactly one \"}, {\" between the two endpoint groups (got %d)", reportTo, n)
+	}
+	for _, want := range []string{`"group":"default"`, `"group":"network-errors"`} {
+		if !strings.Contains(reportTo, want) {
+			t.Errorf("Report-To = %q, want it to contain %q", reportTo, want)
+		}
+	}
+
+	nel := rec.Header().Get("NEL")
+	for _, want := range []string{`"report_to":"network-errors"`, `"max_age":3600`, `"include_subdomains":true`, `"success_fraction":0.5`} {
+		if !strings.Contains(nel, want) {
+			t.Errorf("NEL = %q, want it to contain %q", nel, want)
+		}
+	}
+
+	if got, want := rec.Header().Get("Cross-Origin-Opener-Policy-Report-Only"), `same-origin; report-to="default"`; got != want {
+		t.Errorf("Cross-Origin-Opener-Policy-Report-Only = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Cross-Origin-Embedder-Policy-Report-Only"), `require-corp; report-to="default"`; got != want {
+		t.Errorf("Cross-Origin-Embedder-Policy-Report-Only = %q, want %q", got, want)
+	}
+}
+
+func TestInterceptorBeforeNoEndpointsNoHeaders(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := safehttp.BrokenNewTask(rec, nil)
+
+	Interceptor{}.Before(w, nil)
+
+	for _, h := range []string{"Reporting-Endpoints", "Report-To", "NEL", "Cross-Origin-Opener-Policy-Report-Only", "Cross-Origin-Embedder-Policy-Report-Only"} {
+		if got := rec.Header().Get(h); got != "" {
+			t.Errorf("Header %q = %q, want unset", h, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"io"
+)
+
+// Context returns the request's context, as per (net/http.Request).Context.
+func (r *IncomingRequest) Context() context.Context {
+	return r.req.Context()
+}
+
+// RemoteAddr returns the network address of the client that sent this
+// request, in the same host:port format as the underlying
+// net/http.Request.RemoteAddr. It is not guaranteed to be parseable and,
+// unless the server is known to sit behind a trusted proxy, is easily
+// spoofed; treat it as a hint for logging, not as an authorization signal.
+func (r *IncomingRequest) RemoteAddr() string {
+	return r.req.RemoteAddr
+}
+
+// URLPath returns the path component of the request's URL.
+func (r *IncomingRequest) URLPath() string {
+	return r.req.URL.Path
+}
+
+// RawQuery returns the (undecoded) query component of the request's URL,
+// without the leading "?".
+func (r *IncomingRequest) RawQuery() string {
+	return r.req.URL.RawQuery
+}
+
+// Body returns the request's body, as per (net/http.Request).Body.
+func (r *IncomingRequest) Body() io.ReadCloser {
+	return r.req.Body
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpc lets a service, defined as a plain Go interface whose methods
+// take a context.Context and a proto.Message and return a proto.Message and
+// an error, be served through the existing safehttp.Dispatcher/Task
+// pipeline, so that CSRF, CORS, CSP, framing and cookie policy interceptors
+// apply to RPCs the same way they do to any other handler.
+//
+// Routing and error handling follow Twirp (https://twitchtv.github.io/twirp/):
+// each method is served at POST /<Service>/<Method>, the request and
+// response are marshaled as either application/protobuf or application/json
+// depending on the request's Content-Type, and a failed RPC is reported as a
+// stable JSON error envelope together with an HTTP status derived from its
+// ErrorCode.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Format is a wire format an RPCDispatcher can marshal a Response with.
+type Format string
+
+const (
+	FormatProtobuf Format = "protobuf"
+	FormatJSON     Format = "json"
+)
+
+const (
+	contentTypeProtobuf = "application/protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// negotiateFormat returns the Format a request's Content-Type selects, or an
+// error if it selects neither of the two formats this package supports.
+// There is deliberately no fallback: an unrecognized Content-Type must fail
+// the request rather than be guessed at.
+func negotiateFormat(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	switch mediaType {
+	case contentTypeProtobuf:
+		return FormatProtobuf, nil
+	case contentTypeJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("rpc: unsupported Content-Type %q, want %q or %q", contentType, contentTypeProtobuf, contentTypeJSON)
+	}
+}
+
+func marshal(f Format, m proto.Message) ([]byte, error) {
+	switch f {
+	case FormatProtobuf:
+		return proto.Marshal(m)
+	case FormatJSON:
+		return protojson.Marshal(m)
+	default:
+		return nil, fmt.Errorf("rpc: unknown format %q", f)
+	}
+}
+
+func unmarshal(f Format, b []byte, m proto.Message) error {
+	switch f {
+	case FormatProtobuf:
+		return proto.Unmarshal(b, m)
+	case FormatJSON:
+		return protojson.Unmarshal(b, m)
+	default:
+		return fmt.Errorf("rpc: unknown format %q", f)
+	}
+}
+
+// ErrorCode is a Twirp-style error code. Each one maps to a fixed HTTP
+// status, via errorCodeStatus, that Server writes when a method returns an
+// *Error of that code.
+type ErrorCode string
+
+const (
+	CodeCanceled           ErrorCode = "canceled"
+	CodeUnknown            ErrorCode = "unknown"
+	CodeInvalidArgument    ErrorCode = "invalid_argument"
+	CodeDeadlineExceeded   ErrorCode = "deadline_exceeded"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeAlreadyExists      ErrorCode = "already_exists"
+	CodePermissionDenied   ErrorCode = "permission_denied"
+	CodeUnauthenticated    ErrorCode = "unauthenticated"
+	CodeResourceExhausted  ErrorCode = "resource_exhausted"
+	CodeFailedPrecondition ErrorCode = "failed_precondition"
+	CodeAborted            ErrorCode = "aborted"
+	CodeOutOfRange         ErrorCode = "out_of_range"
+	CodeUnimplemented      ErrorCode = "unimplemented"
+	CodeInternal           ErrorCode = "internal"
+	CodeUnavailable        ErrorCode = "unavailable"
+	CodeDataLoss           ErrorCode = "dataloss"
+)
+
+// errorCodeStatus maps each ErrorCode to the HTTP status Server writes for
+// it. It follows Twirp's own table except for CodeCanceled and
+// CodeDeadlineExceeded, which map to 499 and 504 here.
+var errorCodeStatus = map[ErrorCode]int{
+	CodeCanceled:           499,
+	CodeUnknown:            http.StatusInternalServerError,
+	CodeInvalidArgument:    http.StatusBadRequest,
+	CodeDeadlineExceeded:   http.StatusGatewayTimeout,
+	CodeNotFound:           http.StatusNotFound,
+	CodeAlreadyExists:      http.StatusConflict,
+	CodePermissionDenied:   http.StatusForbidden,
+	CodeUnauthenticated:    http.StatusUnauthorized,
+	CodeResourceExhausted:  http.StatusTooManyRequests,
+	CodeFailedPrecondition: http.StatusPreconditionFailed,
+	CodeAborted:            http.StatusConflict,
+	CodeOutOfRange:         http.StatusBadRequest,
+	CodeUnimplemented:      http.StatusNotImplemented,
+	CodeInternal:           http.StatusInternalServerError,
+	CodeUnavailable:        http.StatusServiceUnavailable,
+	CodeDataLoss:           http.StatusInternalServerError,
+}
+
+// Error is the error type a service method should return to control the
+// status code and JSON error envelope Server writes. Any other error
+// returned by a method is reported as CodeInternal instead.
+type Error struct {
+	Code ErrorCode
+	Msg  string
+	Meta map[string]string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("rpc error: %s: %s", e.Code, e.Msg) }
+
+// NewError returns an *Error with the given code and message.
+func NewError(code ErrorCode, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+// asError normalizes err into an *Error, wrapping it as CodeInternal if it
+// isn't already one.
+func asError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{Code: CodeInternal, Msg: err.Error()}
+}
+
+func (e *Error) status() int {
+	if status, ok := errorCodeStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// errorEnvelope is the stable JSON shape an *Error is marshaled to,
+// regardless of which Format the failed request used.
+type errorEnvelope struct {
+	Code string            `json:"code"`
+	Msg  string            `json:"msg"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// ServerHooks lets callers observe and influence each phase of serving an
+// RPC, mirroring Twirp's own ServerHooks.
+type ServerHooks struct {
+	// RequestReceived is called once a request has been routed to a known
+	// service and method, before its body is read or decoded. Returning an
+	// error aborts the request with that error.
+	RequestReceived func(ctx context.Context) (context.Context, error)
+	// RequestRouted is called once the request body has been decoded into
+	// the method's request message, before the method itself runs.
+	// Returning an error aborts the request with that error.
+	RequestRouted func(ctx context.Context) (context.Context, error)
+	// ResponsePrepared is called once the method has returned successfully,
+	// before the response is marshaled and written.
+	ResponsePrepared func(ctx context.Context) context.Context
+	// ResponseSent is called after a successful response has been written.
+	ResponseSent func(ctx context.Context)
+	// Error is called whenever a request fails, including routing and
+	// decoding failures, with the normalized *Error that will be written.
+	Error func(ctx context.Context, err *Error) context.Context
+}
+
+// Response wraps a proto.Message returned by a Server method together with
+// the Format it must be marshaled with. Format always equals whatever the
+// originating request negotiated, so RPCDispatcher.ContentType necessarily
+// matches the request it is responding to; there is no path by which the
+// two can drift apart.
+type Response struct {
+	Message proto.Message
+	Format  Format
+}
+
+// errorResponse carries a failed RPC's *Error. It is always marshaled as
+// JSON by RPCDispatcher, regardless of the request's Format, matching
+// Twirp's error envelope.
+type errorResponse struct {
+	err *Error
+}
+
+// RPCDispatcher implements safehttp.Dispatcher for Response and the error
+// envelope Server writes on failure. Any other safehttp.Response is
+// rejected outright rather than silently falling back to an unchecked
+// format, preserving the same safety guarantee as DefaultDispatcher.
+type RPCDispatcher struct{}
+
+// ContentType returns the Content-Type Write will use for resp.
+func (RPCDispatcher) ContentType(resp safehttp.Response) (string, error) {
+	switch r := resp.(type) {
+	case Response:
+		switch r.Format {
+		case FormatProtobuf:
+			return contentTypeProtobuf, nil
+		case FormatJSON:
+			return contentTypeJSON, nil
+		default:
+			return "", fmt.Errorf("rpc: unknown format %q", r.Format)
+		}
+	case errorResponse:
+		return contentTypeJSON, nil
+	default:
+		return "", fmt.Errorf("rpc: %T is not a response RPCDispatcher can write", resp)
+	}
+}
+
+// Write marshals resp and writes it to rw.
+func (RPCDispatcher) Write(rw http.ResponseWriter, resp safehttp.Response) error {
+	switch r := resp.(type) {
+	case Response:
+		b, err := marshal(r.Format, r.Message)
+		if err != nil {
+			return err
+		}
+		_, err = rw.Write(b)
+		return err
+	case errorResponse:
+		return json.NewEncoder(rw).Encode(errorEnvelope{
+			Code: string(r.err.Code),
+			Msg:  r.err.Msg,
+			Meta: r.err.Meta,
+		})
+	default:
+		return fmt.Errorf("rpc: %T is not a response RPCDispatcher can write", resp)
+	}
+}
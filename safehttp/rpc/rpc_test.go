@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		code ErrorCode
+		want int
+	}{
+		{CodeNotFound, http.StatusNotFound},
+		{CodeInvalidArgument, http.StatusBadRequest},
+		{CodePermissionDenied, http.StatusForbidden},
+		{CodeInternal, http.StatusInternalServerError},
+		{ErrorCode("not_a_real_code"), http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		err := NewError(tc.code, "boom")
+		if got := err.status(); got != tc.want {
+			t.Errorf("NewError(%q, ...).status() = %d, want %d", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestAsError(t *testing.T) {
+	rpcErr := NewError(CodeNotFound, "missing")
+	if got := asError(rpcErr); got != rpcErr {
+		t.Errorf("asError(rpcErr) = %v, want the same *Error back", got)
+	}
+
+	wrapped := asError(errors.New("plain error"))
+	if wrapped.Code != CodeInternal {
+		t.Errorf("asError(plain error).Code = %q, want %q", wrapped.Code, CodeInternal)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Format
+		wantErr     bool
+	}{
+		{"application/protobuf", FormatProtobuf, false},
+		{"application/json", FormatJSON, false},
+		{"application/json; charset=utf-8", FormatJSON, false},
+		{"text/plain", "", true},
+		{"", "", true},
+	}
+	for _, tc := range tests {
+		got, err := negotiateFormat(tc.contentType)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("negotiateFormat(%q) error = %v, wantErr %v", tc.contentType, err, tc.wantErr)
+			continue
+		}
+		if err == nil && got != tc.want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", tc.contentType, got, tc.want)
+		}
+	}
+}
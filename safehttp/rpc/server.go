@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	protoType   = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// method is a single routable RPC: an exported method of the service value
+// passed to NewServer with signature func(context.Context, proto.Message)
+// (proto.Message, error).
+type method struct {
+	fn      reflect.Value
+	reqType reflect.Type
+}
+
+// Server is a safehttp.Handler that routes POST /<Service>/<Method>
+// requests to the matching method of the service it was built from.
+type Server struct {
+	name    string
+	methods map[string]method
+	hooks   ServerHooks
+}
+
+// Option configures a Server built by NewServer.
+type Option func(*Server)
+
+// WithServiceName overrides the name Server uses to build each method's
+// route, /<name>/<Method>. By default it is the unqualified type name of
+// the svc value passed to NewServer.
+func WithServiceName(name string) Option {
+	return func(s *Server) { s.name = name }
+}
+
+// WithHooks installs h on the Server, replacing any hooks installed by an
+// earlier WithHooks option.
+func WithHooks(h ServerHooks) Option {
+	return func(s *Server) { s.hooks = h }
+}
+
+// NewServer builds a Server for svc. Every exported method of svc with
+// signature func(context.Context, <T proto.Message>) (<U proto.Message>,
+// error) becomes an RPC method, routed as POST /<Service>/<Method>; any
+// other exported method is ignored, so svc may implement unrelated
+// interfaces too. The Dispatcher passed to the safehttp.HandlerConfig that
+// wraps the returned Server must be, or embed, RPCDispatcher.
+func NewServer(svc interface{}, opts ...Option) *Server {
+	s := &Server{
+		name:    serviceName(svc),
+		methods: map[string]method{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	v := reflect.ValueOf(svc)
+	t := v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		fn := v.Method(i)
+		ft := fn.Type()
+		if ft.NumIn() != 2 || ft.NumOut() != 2 {
+			continue
+		}
+		if ft.In(0) != contextType || !ft.In(1).Implements(protoType) {
+			continue
+		}
+		if !ft.Out(0).Implements(protoType) || ft.Out(1) != errorType {
+			continue
+		}
+		s.methods[name] = method{fn: fn, reqType: ft.In(1)}
+	}
+	return s
+}
+
+func serviceName(svc interface{}) string {
+	t := reflect.TypeOf(svc)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// ServeHTTP implements safehttp.Handler. r's path must be
+// /<Service>/<Method> for a method this Server was built with; the request
+// body is decoded as protobuf or JSON according to Content-Type, with no
+// fallback for an unrecognized one, and the result (or a failure) is
+// written through RPCDispatcher.
+func (s *Server) ServeHTTP(w *safehttp.Task, r *safehttp.IncomingRequest) safehttp.Result {
+	ctx := r.Context()
+
+	if r.Method() != safehttp.MethodPost {
+		return s.writeError(w, ctx, NewError(CodeUnimplemented, "RPC methods only accept POST"))
+	}
+
+	m, ok := s.methods[s.methodName(r.URLPath())]
+	if !ok {
+		return s.writeError(w, ctx, NewError(CodeNotFound, "unknown method "+r.URLPath()))
+	}
+
+	format, err := negotiateFormat(r.Header.Get("Content-Type"))
+	if err != nil {
+		return s.writeError(w, ctx, NewError(CodeInvalidArgument, err.Error()))
+	}
+
+	if s.hooks.RequestReceived != nil {
+		if ctx, err = s.hooks.RequestReceived(ctx); err != nil {
+			return s.writeError(w, ctx, asError(err))
+		}
+	}
+
+	body, err := io.ReadAll(r.Body())
+	if err != nil {
+		return s.writeError(w, ctx, NewError(CodeInvalidArgument, "could not read request body"))
+	}
+	req := reflect.New(m.reqType.Elem()).Interface().(proto.Message)
+	if err := unmarshal(format, body, req); err != nil {
+		return s.writeError(w, ctx, NewError(CodeInvalidArgument, "could not decode request: "+err.Error()))
+	}
+
+	if s.hooks.RequestRouted != nil {
+		if ctx, err = s.hooks.RequestRouted(ctx); err != nil {
+			return s.writeError(w, ctx, asError(err))
+		}
+	}
+
+	out := m.fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(req)})
+	if errVal, _ := out[1].Interface().(error); errVal != nil {
+		return s.writeError(w, ctx, asError(errVal))
+	}
+
+	if s.hooks.ResponsePrepared != nil {
+		ctx = s.hooks.ResponsePrepared(ctx)
+	}
+	result := w.Write(Response{Message: out[0].Interface().(proto.Message), Format: format})
+	if s.hooks.ResponseSent != nil {
+		s.hooks.ResponseSent(ctx)
+	}
+	return result
+}
+
+// methodName returns the method name routed by path, i.e. path with the
+// "/<Service>/" prefix this Server serves removed, or "" if path isn't
+// routed by this Server at all.
+func (s *Server) methodName(path string) string {
+	prefix := "/" + s.name + "/"
+	if !strings.HasPrefix(path, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(path, prefix)
+}
+
+func (s *Server) writeError(w *safehttp.Task, ctx context.Context, err *Error) safehttp.Result {
+	if s.hooks.Error != nil {
+		s.hooks.Error(ctx, err)
+	}
+	w.SetCode(safehttp.StatusCode(err.status()))
+	return w.Write(errorResponse{err: err})
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// echoService is a minimal service used to exercise NewServer's reflection
+// and Server's routing/marshaling end to end. It uses wrapperspb.StringValue,
+// a real generated proto.Message, so the test needs no .proto/protoc step of
+// its own.
+type echoService struct{}
+
+func (echoService) Echo(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	if req.GetValue() == "fail" {
+		return nil, NewError(CodeInvalidArgument, "told to fail")
+	}
+	return wrapperspb.String("echo: " + req.GetValue()), nil
+}
+
+func echoHandlerConfig() safehttp.HandlerConfig {
+	return safehttp.HandlerConfig{
+		Handler:    NewServer(echoService{}),
+		Dispatcher: RPCDispatcher{},
+	}
+}
+
+func TestServerServeHTTPProtobuf(t *testing.T) {
+	body, err := proto.Marshal(wrapperspb.String("hi"))
+	if err != nil {
+		t.Fatalf("proto.Marshal(request): %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/echoService/Echo", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	rec := httptest.NewRecorder()
+
+	safehttp.ProcessRequest(echoHandlerConfig(), rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body = %q", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != contentTypeProtobuf {
+		t.Errorf("Content-Type = %q, want %q", got, contentTypeProtobuf)
+	}
+	var got wrapperspb.StringValue
+	if err := proto.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("proto.Unmarshal(response): %v", err)
+	}
+	if want := "echo: hi"; got.GetValue() != want {
+		t.Errorf("response value = %q, want %q", got.GetValue(), want)
+	}
+}
+
+func TestServerServeHTTPJSON(t *testing.T) {
+	// google.protobuf.StringValue is a well-known wrapper type: protojson
+	// maps it directly to a bare JSON string, not {"value": ...}.
+	req := httptest.NewRequest(http.MethodPost, "/echoService/Echo", strings.NewReader(`"hi"`))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	rec := httptest.NewRecorder()
+
+	safehttp.ProcessRequest(echoHandlerConfig(), rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body = %q", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var got string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(response): %v", err)
+	}
+	if want := "echo: hi"; got != want {
+		t.Errorf("response value = %q, want %q", got, want)
+	}
+}
+
+func TestServerServeHTTPMethodError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/echoService/Echo", strings.NewReader(`"fail"`))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	rec := httptest.NewRecorder()
+
+	safehttp.ProcessRequest(echoHandlerConfig(), rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d; body = %q", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	var envelope errorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("json.Unmarshal(error envelope): %v", err)
+	}
+	if envelope.Code != string(CodeInvalidArgument) {
+		t.Errorf("envelope.Code = %q, want %q", envelope.Code, CodeInvalidArgument)
+	}
+}
+
+func TestServerServeHTTPUnknownMethod(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/echoService/DoesNotExist", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	rec := httptest.NewRecorder()
+
+	safehttp.ProcessRequest(echoHandlerConfig(), rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d; body = %q", rec.Code, http.StatusNotFound, rec.Body.String())
+	}
+}
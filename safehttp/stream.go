@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-safeweb/safehttp/internal/metrics"
+)
+
+// StreamingDispatcher is the streaming counterpart of Dispatcher. Instead of
+// writing a Response in one shot, its WriteStream method drives a producer
+// that pushes chunks of the response to the client as they become
+// available, e.g. Server-Sent Events or newline-delimited JSON.
+//
+// The implementation of a custom StreamingDispatcher should be thoroughly
+// reviewed by the security team to avoid introducing vulnerabilities.
+type StreamingDispatcher interface {
+	// A StreamingDispatcher reuses Dispatcher.ContentType: it must
+	// recognize StreamingResponse types (SSEResponse, NDJSONResponse, ...)
+	// in addition to whatever one-shot Response types it already handles.
+	Dispatcher
+
+	// WriteStream drives a streaming response: resp is expected to carry
+	// the producer that generates chunks (see SSEResponse and
+	// NDJSONResponse), and emit is called, in order, once per chunk that
+	// producer wants to send. WriteStream should return an error if resp is
+	// of a type this StreamingDispatcher does not support, or if emit does.
+	WriteStream(rw http.ResponseWriter, resp Response, emit func(chunk Response) error) error
+}
+
+// StreamingResponse marks a Response as streamable with Task.Stream. The
+// unexported method seals it to this package; SSEResponse and NDJSONResponse
+// are the built-in implementations.
+type StreamingResponse interface {
+	streamingResponse()
+}
+
+// Stream runs the StreamCommit phase of the interceptors once (the
+// interceptors' Commit phase, which Write runs, is not run), then flushes
+// the header immediately and hands control to the Dispatcher so it can push
+// chunks to the client as they become available instead of all at once.
+//
+// The Dispatcher configured on the handler must also implement
+// StreamingDispatcher, and the underlying http.ResponseWriter must support
+// http.Flusher. ProcessRequest and BrokenNewTask route the writer through
+// the wrap package, which keeps http.Flusher only if the writer passed to
+// them implements it. This method panics otherwise.
+//
+// If the ResponseWriter has already been written to, then this method will panic.
+func (t *Task) Stream(resp StreamingResponse) Result {
+	if t.written {
+		panic("ResponseWriter was already written to")
+	}
+	t.written = true
+	t.streamCommitPhase(resp)
+
+	sd, ok := t.cfg.Dispatcher.(StreamingDispatcher)
+	if !ok {
+		panic(fmt.Sprintf("Dispatcher %T does not implement StreamingDispatcher", t.cfg.Dispatcher))
+	}
+
+	ct, err := sd.ContentType(resp)
+	if err != nil {
+		metrics.ContentTypeRejections.Add(1)
+		panic(err)
+	}
+	t.rw.Header().Set("Content-Type", ct)
+
+	if t.code == 0 {
+		t.code = StatusOK
+	}
+	t.rw.WriteHeader(int(t.code))
+
+	f, ok := t.rw.(http.Flusher)
+	if !ok {
+		panic("underlying ResponseWriter does not support flushing, required to stream a response")
+	}
+	f.Flush()
+
+	emit := func(chunk Response) error {
+		b, ok := chunk.([]byte)
+		if !ok {
+			return fmt.Errorf("safehttp: streaming chunk must be []byte once framed by the Dispatcher, got %T", chunk)
+		}
+		if _, err := t.rw.Write(b); err != nil {
+			return err
+		}
+		f.Flush()
+		return nil
+	}
+
+	if err := sd.WriteStream(t.rw, resp, emit); err != nil {
+		panic(err)
+	}
+	return Result{}
+}
+
+// streamCommitInterceptor is implemented by interceptors, such as CSP or
+// CSRF, that need to contribute to or inspect a streamed response before its
+// header is flushed. It mirrors afterResponseInterceptor: an optional,
+// type-asserted hook rather than a mandatory method of
+// ConfiguredInterceptor, so existing interceptors that only ever see
+// one-shot responses keep compiling unchanged.
+type streamCommitInterceptor interface {
+	StreamCommit(t *Task, r *IncomingRequest, resp StreamingResponse)
+}
+
+// streamCommitPhase calls the StreamCommit phase of every configured
+// interceptor that implements streamCommitInterceptor, in the same reverse
+// order as commitPhase. It runs before the header is flushed, so
+// interceptors like CSP/CSRF can still contribute headers before the first
+// byte of a streamed response is sent.
+func (t *Task) streamCommitPhase(resp StreamingResponse) {
+	for i := len(t.cfg.Interceptors) - 1; i >= 0; i-- {
+		it := t.cfg.Interceptors[i]
+		if sc, ok := it.(streamCommitInterceptor); ok {
+			timeInterceptorPhase(it, "StreamCommit", func() { sc.StreamCommit(t, t.req, resp) })
+		}
+	}
+}
+
+// SSEEvent is a single Server-Sent Event, as specified by
+// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+type SSEEvent struct {
+	// Event is the event's type. Leave empty for the default "message" type.
+	Event string
+	// Data is the event's payload. Embedded newlines are framed as multiple
+	// "data:" lines, as the spec requires.
+	Data string
+	// ID, if non-empty, sets the event stream's last event ID.
+	ID string
+	// Retry, if positive, is the reconnection time in milliseconds the
+	// client should use if the connection is dropped.
+	Retry int
+}
+
+// SSEResponse is a StreamingResponse rendered as Server-Sent Events.
+// Generate is called once, synchronously, by the Dispatcher; it should call
+// emit, in order, for every event to send and return once the stream is
+// finished.
+type SSEResponse struct {
+	Generate func(emit func(SSEEvent) error) error
+}
+
+func (SSEResponse) streamingResponse() {}
+
+// NDJSONResponse is a StreamingResponse rendered as newline-delimited JSON
+// (see http://ndjson.org/): each chunk is marshaled with encoding/json and
+// followed by a single "\n". Generate is called once, synchronously, by the
+// Dispatcher.
+type NDJSONResponse struct {
+	Generate func(emit func(v interface{}) error) error
+}
+
+func (NDJSONResponse) streamingResponse() {}
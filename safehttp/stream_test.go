@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestDefaultDispatcherWriteSSEStream(t *testing.T) {
+	d := &safehttp.DefaultDispatcher{}
+
+	var chunks []string
+	emit := func(chunk safehttp.Response) error {
+		b := chunk.([]byte)
+		chunks = append(chunks, string(b))
+		return nil
+	}
+
+	resp := safehttp.SSEResponse{
+		Generate: func(emit func(safehttp.SSEEvent) error) error {
+			if err := emit(safehttp.SSEEvent{Event: "greeting", Data: "hello\nworld", ID: "1"}); err != nil {
+				return err
+			}
+			return emit(safehttp.SSEEvent{Data: "done"})
+		},
+	}
+
+	if err := d.WriteStream(nil, resp, emit); err != nil {
+		t.Fatalf("WriteStream: got error %v, want nil", err)
+	}
+
+	want := []string{
+		"id: 1\nevent: greeting\ndata: hello\ndata: world\n\n",
+		"data: done\n\n",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %q", len(chunks), len(want), chunks)
+	}
+	for i, c := range chunks {
+		if c != want[i] {
+			t.Errorf("chunk %d: got %q, want %q", i, c, want[i])
+		}
+	}
+}
+
+func TestDefaultDispatcherWriteNDJSONStream(t *testing.T) {
+	d := &safehttp.DefaultDispatcher{}
+
+	var got strings.Builder
+	emit := func(chunk safehttp.Response) error {
+		got.Write(chunk.([]byte))
+		return nil
+	}
+
+	resp := safehttp.NDJSONResponse{
+		Generate: func(emit func(v interface{}) error) error {
+			if err := emit(map[string]string{"field": "a"}); err != nil {
+				return err
+			}
+			return emit(map[string]string{"field": "b"})
+		},
+	}
+
+	if err := d.WriteStream(nil, resp, emit); err != nil {
+		t.Fatalf("WriteStream: got error %v, want nil", err)
+	}
+
+	want := "{\"field\":\"a\"}\n{\"field\":\"b\"}\n"
+	if got.String() != want {
+		t.Errorf("body: got %q, want %q", got.String(), want)
+	}
+}
+
+func TestDefaultDispatcherContentTypeRejectsUnknownResponse(t *testing.T) {
+	d := &safehttp.DefaultDispatcher{}
+	if _, err := d.ContentType("not a streaming response"); err == nil {
+		t.Error("ContentType: got nil error, want non-nil for an unsupported Response")
+	}
+}
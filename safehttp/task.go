@@ -15,7 +15,13 @@
 package safehttp
 
 import (
+	"fmt"
 	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp/internal/metrics"
+	"github.com/google/go-safeweb/safehttp/internal/wrap"
 )
 
 type Task struct {
@@ -29,6 +35,74 @@ type Task struct {
 
 	written      bool
 	writtenError bool
+
+	// start is when this Task was created, used by interceptors such as
+	// reqlog.LoggingInterceptor to compute request duration.
+	start time.Time
+
+	// writtenStatus and writtenSize are filled in, via the hooks installed
+	// in newTask, as soon as the response is actually written to rw. They
+	// stay zero until then.
+	writtenStatus int
+	writtenSize   int
+
+	// shortCircuitedBy is the name of the interceptor whose Before phase
+	// wrote a response, preventing the handler and subsequent interceptors
+	// from running. It is empty if the chain completed normally.
+	shortCircuitedBy string
+
+	// recoveredValue and recoveredStack hold the panic recovered from the
+	// handler or an interceptor, if any; see Recovered. recoveredStack is
+	// bounded to maxRecoveredStackSize bytes (see boundedStack).
+	recoveredValue interface{}
+	recoveredStack []byte
+}
+
+// maxRecoveredStackSize bounds how much of a panic's stack trace
+// boundedStack keeps, so a pathologically deep (e.g. infinitely recursive)
+// panic can't balloon a single request's memory use.
+const maxRecoveredStackSize = 16 * 1024
+
+// boundedStack returns the current goroutine's stack trace, truncated to at
+// most maxRecoveredStackSize bytes.
+func boundedStack() []byte {
+	stack := debug.Stack()
+	if len(stack) > maxRecoveredStackSize {
+		stack = stack[:maxRecoveredStackSize]
+	}
+	return stack
+}
+
+// newTask builds a Task around rw, wrapping it so that response status and
+// size are always tracked (see Task.ResponseStatus and Task.ResponseSize),
+// regardless of which interceptors, if any, are configured.
+//
+// newTask itself does not record into metrics: BrokenNewTask builds a Task
+// that never runs processRequest, so the request/in-flight bookkeeping lives
+// there instead, where it's guaranteed to be unwound.
+func newTask(cfg HandlerConfig, rw http.ResponseWriter, req *IncomingRequest) *Task {
+	t := &Task{cfg: cfg, req: req, start: time.Now()}
+	rw = wrap.Wrap(rw, wrap.Hooks{
+		WriteHeader: func(next func(code int)) func(code int) {
+			return func(code int) {
+				t.writtenStatus = code
+				next(code)
+			}
+		},
+		Write: func(next func(b []byte) (int, error)) func(b []byte) (int, error) {
+			return func(b []byte) (int, error) {
+				if t.writtenStatus == 0 {
+					t.writtenStatus = http.StatusOK
+				}
+				n, err := next(b)
+				t.writtenSize += n
+				return n, err
+			}
+		},
+	})
+	t.rw = rw
+	t.header = newHeader(rw.Header())
+	return t
 }
 
 // NewTask creates a ResponseWriter from a safehttp.Dispatcher, an
@@ -39,52 +113,144 @@ type Task struct {
 
 // ProperNewTask TODO
 func BrokenNewTask(rw http.ResponseWriter, dispatcher Dispatcher) *Task {
-	return &Task{
-		cfg:    HandlerConfig{Dispatcher: dispatcher},
-		rw:     rw,
-		header: newHeader(rw.Header()),
-	}
+	return newTask(HandlerConfig{Dispatcher: dispatcher}, rw, nil)
 }
 
 type HandlerConfig struct {
 	Handler      Handler
 	Dispatcher   Dispatcher
 	Interceptors []ConfiguredInterceptor
+
+	// Pattern is the route pattern (or other stable name) this Handler was
+	// registered under. It has no effect on routing; it is only used to
+	// label the per-handler metrics in safehttp/debug. Leave empty if not
+	// applicable.
+	Pattern string
 }
 
 func ProcessRequest(cfg HandlerConfig, rw http.ResponseWriter, req *http.Request) {
-	t := &Task{
-		cfg:    cfg,
-		rw:     rw,
-		header: newHeader(rw.Header()),
-		req:    NewIncomingRequest(req),
-	}
+	t := newTask(cfg, rw, NewIncomingRequest(req))
 	t.processRequest()
 }
 
+// ResponseStatus returns the status code that was actually written to the
+// underlying http.ResponseWriter, or 0 if nothing has been written yet.
+func (t *Task) ResponseStatus() int {
+	return t.writtenStatus
+}
+
+// ResponseSize returns the number of response body bytes that have been
+// written to the underlying http.ResponseWriter so far.
+func (t *Task) ResponseSize() int {
+	return t.writtenSize
+}
+
+// Started returns when this Task was created, i.e. when the request started
+// being processed.
+func (t *Task) Started() time.Time {
+	return t.start
+}
+
+// ShortCircuitedBy returns the name of the interceptor whose Before phase
+// wrote a response, if any, preventing the handler and subsequent
+// interceptors from running. It returns "" if the chain completed normally.
+func (t *Task) ShortCircuitedBy() string {
+	return t.shortCircuitedBy
+}
+
+// Recovered returns the value and stack trace of the panic, if any, that was
+// recovered while processing this request. ok is false if nothing has
+// panicked (yet).
+func (t *Task) Recovered() (value interface{}, stack []byte, ok bool) {
+	return t.recoveredValue, t.recoveredStack, t.recoveredValue != nil
+}
+
+// ResponseWriter returns the underlying http.ResponseWriter of this Task.
+// It is exposed so that a Handler can type-assert it to an optional
+// interface such as http.Flusher, http.Hijacker, io.ReaderFrom or
+// http.Pusher, e.g. for SSE, WebSocket upgrades, HTTP/2 push or efficient
+// file serving. The returned writer only implements the subset of those
+// interfaces that the writer passed to ProcessRequest/BrokenNewTask did.
+//
+// Calling Write, WriteHeader or any other method that bypasses the commit
+// phase directly on the returned writer skips the safety guarantees this
+// package provides; prefer Task's own methods whenever possible.
+func (t *Task) ResponseWriter() http.ResponseWriter {
+	return t.rw
+}
+
 func (t *Task) processRequest() {
+	metrics.Requests.Add(1)
+	metrics.InFlight.Add(1)
+	defer t.afterPhase()
+
 	// The `net/http` package recovers handler panics, but we cannot rely on that behavior here.
 	// The reason is, we might need to run After/Commit stages of the interceptors before we
 	// respond with a 500 Internal Server Error.
 	defer func() {
 		if r := recover(); r != nil {
+			metrics.PanicsRecovered.Add(1)
+			t.recoveredValue = r
+			t.recoveredStack = boundedStack()
 			t.WriteError(StatusInternalServerError)
 		}
 	}()
 
 	for _, it := range t.cfg.Interceptors {
-		it.Before(t, t.req)
+		timeInterceptorPhase(it, "Before", func() { it.Before(t, t.req) })
 		if t.written {
+			t.shortCircuitedBy = fmt.Sprintf("%T", it)
 			return
 		}
 	}
 
+	handlerStart := time.Now()
 	t.cfg.Handler.ServeHTTP(t, t.req)
+	metrics.HandlerDuration.Observe(t.cfg.Pattern, time.Since(handlerStart))
+
 	if !t.written {
 		t.NoContent()
 	}
 }
 
+// afterResponseInterceptor is implemented by interceptors, such as
+// reqlog.LoggingInterceptor, that need to observe the fully-written
+// response (status, size, duration) once the request has finished
+// processing, which is too late for Commit or OnError to still run safely.
+type afterResponseInterceptor interface {
+	AfterResponse(t *Task, r *IncomingRequest)
+}
+
+// afterPhase calls AfterResponse on every configured interceptor that
+// implements afterResponseInterceptor, in registration order, once the
+// response has been fully written (or the request has panicked past
+// recovery), then records this request's final status class and total
+// duration, and marks it as no longer in flight. It is only deferred by
+// processRequest, so it balances the Requests/InFlight bookkeeping done
+// there; a Task built via BrokenNewTask never runs either.
+func (t *Task) afterPhase() {
+	for _, it := range t.cfg.Interceptors {
+		if ar, ok := it.(afterResponseInterceptor); ok {
+			ar.AfterResponse(t, t.req)
+		}
+	}
+
+	if class := metrics.StatusClass(t.writtenStatus); class != "" {
+		metrics.StatusClasses.Add(class, 1)
+	}
+	metrics.RequestDuration.Observe("", time.Since(t.start))
+	metrics.InFlight.Add(-1)
+}
+
+// timeInterceptorPhase runs fn, which must invoke the named phase of it, and
+// records how long that took in metrics.InterceptorDuration, keyed by it's
+// concrete type and phase.
+func timeInterceptorPhase(it ConfiguredInterceptor, phase string, fn func()) {
+	start := time.Now()
+	fn()
+	metrics.InterceptorDuration.Observe(fmt.Sprintf("%T %s", it, phase), time.Since(start))
+}
+
 // Write dispatches the response to the Dispatcher. This will be written to the
 // underlying http.ResponseWriter if the Dispatcher decides it's safe to do so.
 //
@@ -98,6 +264,7 @@ func (t *Task) Write(resp Response) Result {
 
 	ct, err := t.cfg.Dispatcher.ContentType(resp)
 	if err != nil {
+		metrics.ContentTypeRejections.Add(1)
 		panic(err)
 	}
 	t.rw.Header().Set("Content-Type", ct)
@@ -202,7 +369,8 @@ func (t *Task) SetCode(code StatusCode) {
 // the Commit phase.
 func (t *Task) commitPhase(resp Response) {
 	for i := len(t.cfg.Interceptors) - 1; i >= 0; i-- {
-		t.cfg.Interceptors[i].Commit(t, t.req, resp)
+		it := t.cfg.Interceptors[i]
+		timeInterceptorPhase(it, "Commit", func() { it.Commit(t, t.req, resp) })
 	}
 }
 
@@ -214,7 +382,8 @@ func (t *Task) commitPhase(resp Response) {
 // in the OnError phase will result in an irrecoverable error.
 func (t *Task) errorPhase(resp Response) {
 	for i := len(t.cfg.Interceptors) - 1; i >= 0; i-- {
-		t.cfg.Interceptors[i].OnError(t, t.req, resp)
+		it := t.cfg.Interceptors[i]
+		timeInterceptorPhase(it, "OnError", func() { it.OnError(t, t.req, resp) })
 	}
 }
 